@@ -14,6 +14,7 @@
 package api
 
 import (
+	"encoding/json"
 	"net/http"
 	"strconv"
 
@@ -91,6 +92,116 @@ func (h *regionLabelHandler) SetRule(w http.ResponseWriter, r *http.Request) {
 	h.rd.JSON(w, http.StatusOK, "Update region label rule successfully.")
 }
 
+// @Tags region_label
+// @Summary Update region label rules in batch.
+// @Accept json
+// @Param patch body []labeler.LabelRulePatch true "Batch of set/delete operations"
+// @Produce json
+// @Success 200 {string} string "Update region label rules successfully."
+// @Failure 400 {string} string "The input is invalid."
+// @Failure 500 {string} string "PD server failed to proceed the request."
+// @Router /config/region-label/rules [patch]
+func (h *regionLabelHandler) PatchRules(w http.ResponseWriter, r *http.Request) {
+	cluster := getCluster(r)
+	var patch []*labeler.LabelRulePatch
+	if err := apiutil.ReadJSONRespondError(h.rd, w, r.Body, &patch); err != nil {
+		return
+	}
+	if err := cluster.GetRegionLabeler().Patch(patch); err != nil {
+		if errs.ErrRegionRuleContent.Equal(err) || errs.ErrHexDecodingString.Equal(err) {
+			h.rd.JSON(w, http.StatusBadRequest, err.Error())
+		} else {
+			h.rd.JSON(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+	h.rd.JSON(w, http.StatusOK, "Update region label rules successfully.")
+}
+
+// @Tags region_label
+// @Summary Reconcile an owner's region label rules to match the given set.
+// @Accept json
+// @Param owner query string true "Owner of the rules"
+// @Param rules body []labeler.LabelRule true "Desired rules for the owner"
+// @Produce json
+// @Success 200 {string} string "Reconcile region label rules successfully."
+// @Failure 400 {string} string "The input is invalid."
+// @Failure 500 {string} string "PD server failed to proceed the request."
+// @Router /config/region-label/rules:reconcile [post]
+func (h *regionLabelHandler) ReconcileRules(w http.ResponseWriter, r *http.Request) {
+	cluster := getCluster(r)
+	owner := r.URL.Query().Get("owner")
+	if owner == "" {
+		h.rd.JSON(w, http.StatusBadRequest, "owner is required")
+		return
+	}
+	var rules []*labeler.LabelRule
+	if err := apiutil.ReadJSONRespondError(h.rd, w, r.Body, &rules); err != nil {
+		return
+	}
+	if err := cluster.GetRegionLabeler().ReconcileLabelRules(owner, rules); err != nil {
+		if errs.ErrRegionRuleContent.Equal(err) || errs.ErrHexDecodingString.Equal(err) {
+			h.rd.JSON(w, http.StatusBadRequest, err.Error())
+		} else {
+			h.rd.JSON(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+	h.rd.JSON(w, http.StatusOK, "Reconcile region label rules successfully.")
+}
+
+// @Tags region_label
+// @Summary Watch region label rule changes, streaming newline-delimited JSON events.
+// @Param revision query integer false "Revision to resume from; 0 watches new events only"
+// @Produce json
+// @Success 200 {object} labeler.LabelRuleEvent
+// @Failure 400 {string} string "The input is invalid."
+// @Failure 410 {string} string "The requested revision has been compacted."
+// @Router /config/region-label/rule/watch [get]
+func (h *regionLabelHandler) WatchRules(w http.ResponseWriter, r *http.Request) {
+	cluster := getCluster(r)
+
+	var revision uint64
+	if v := r.URL.Query().Get("revision"); v != "" {
+		parsed, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			h.rd.JSON(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		revision = parsed
+	}
+
+	events, err := cluster.GetRegionLabeler().Watch(r.Context(), revision)
+	if err != nil {
+		if err == labeler.ErrCompacted {
+			h.rd.JSON(w, http.StatusGone, err.Error())
+		} else {
+			h.rd.JSON(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		h.rd.JSON(w, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	encoder := json.NewEncoder(w)
+	for {
+		select {
+		case event := <-events:
+			if err := encoder.Encode(event); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
 // @Tags region_label
 // @Summary Get label of a region.
 // @Param id path integer true "Region Id"
@@ -139,4 +250,33 @@ func (h *regionLabelHandler) GetRegionLabels(w http.ResponseWriter, r *http.Requ
 	}
 	labels := cluster.GetRegionLabeler().GetRegionLabels(region)
 	h.rd.JSON(w, http.StatusOK, labels)
+}
+
+// @Tags region_label
+// @Summary Check whether a txn scope is compatible with a region's txn_scope label.
+// @Param id path integer true "Region Id"
+// @Param scope path string true "Txn scope requested by the client"
+// @Produce json
+// @Success 200 {boolean} bool
+// @Failure 400 {string} string "The input is invalid."
+// @Failure 404 {string} string "The region does not exist."
+// @Router /region/id/{id}/txn-scope/{scope}/validate [get]
+func (h *regionLabelHandler) ValidateStaleRead(w http.ResponseWriter, r *http.Request) {
+	cluster := getCluster(r)
+	regionID, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		h.rd.JSON(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	txnScope := mux.Vars(r)["scope"]
+	region := cluster.GetRegion(regionID)
+	if region == nil {
+		h.rd.JSON(w, http.StatusNotFound, nil)
+		return
+	}
+	// A region with no txn_scope label is unconstrained and accepts reads
+	// for any scope; TiDB falls back to inferring scope from store labels
+	// in that case.
+	regionScope := cluster.GetRegionLabeler().GetRegionTxnScope(region)
+	h.rd.JSON(w, http.StatusOK, regionScope == "" || regionScope == txnScope)
 }
\ No newline at end of file
@@ -15,10 +15,13 @@ package labeler
 
 import (
 	"bytes"
+	"context"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/pingcap/log"
 	"github.com/tikv/pd/pkg/errs"
@@ -26,26 +29,246 @@ import (
 	"go.uber.org/zap"
 )
 
+// labelGCInterval is how often the background goroutine scans labelRules
+// for expired entries.
+const labelGCInterval = time.Minute
+
+// watchHistoryLimit bounds the ring buffer of recent events kept so late
+// Watch subscribers can replay from an older revision.
+const watchHistoryLimit = 1000
+
+// watchBufferSize is the per-subscriber channel capacity, so a slow
+// consumer doesn't block rule mutations.
+const watchBufferSize = 64
+
+// ErrCompacted is returned by Watch when the requested revision has fallen
+// out of the retained event history.
+var ErrCompacted = errors.New("requested revision has been compacted")
+
+// StoreResolver resolves a store ID to its current StoreInfo. It is
+// optional: until SetStoreResolver is called, StoreLabelSelector rules
+// simply never match.
+type StoreResolver interface {
+	GetStore(storeID uint64) *core.StoreInfo
+}
+
 // RegionLabeler is utility to label regions.
 type RegionLabeler struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
 	storage *core.Storage
 	sync.RWMutex
 	labelRules map[string]*LabelRule
+	stores     StoreResolver
+
+	watchMu     sync.RWMutex
+	revision    uint64
+	events      []LabelRuleEvent
+	subscribers map[chan LabelRuleEvent]*labelRuleSubscriber
+}
+
+// labelRuleSubscriber holds the events queued for one Watch subscriber that
+// haven't been delivered to its channel yet: the backlog it reconnected
+// with, plus any live events emit appended since. pending is only ever
+// touched under RegionLabeler.watchMu; wake is a one-slot channel that emit
+// signals under watchMu and the subscriber's goroutine receives from
+// without it.
+type labelRuleSubscriber struct {
+	pending []LabelRuleEvent
+	wake    chan struct{}
 }
 
 // NewRegionLabeler creates a Labeler instance.
 func NewRegionLabeler(storage *core.Storage) (*RegionLabeler, error) {
+	ctx, cancel := context.WithCancel(context.Background())
 	l := &RegionLabeler{
-		storage:    storage,
-		labelRules: map[string]*LabelRule{},
+		ctx:         ctx,
+		cancel:      cancel,
+		storage:     storage,
+		labelRules:  map[string]*LabelRule{},
+		subscribers: map[chan LabelRuleEvent]*labelRuleSubscriber{},
 	}
 
 	if err := l.loadRules(); err != nil {
+		cancel()
 		return nil, err
 	}
+	go l.runGC()
 	return l, nil
 }
 
+// Close stops the background label-rule GC goroutine.
+func (l *RegionLabeler) Close() {
+	l.cancel()
+}
+
+// SetStoreResolver wires a StoreResolver so StoreLabelSelector rules can be
+// evaluated against live store labels.
+func (l *RegionLabeler) SetStoreResolver(stores StoreResolver) {
+	l.Lock()
+	defer l.Unlock()
+	l.stores = stores
+}
+
+// ruleMatches reports whether rule applies to region. Rule types that can
+// be decided from the region alone delegate to LabelRule.IsMatch;
+// StoreLabelSelector additionally needs live store labels, which only
+// RegionLabeler has access to.
+func (l *RegionLabeler) ruleMatches(rule *LabelRule, region *core.RegionInfo) bool {
+	if rule.RuleType != StoreLabelSelector {
+		return rule.IsMatch(region)
+	}
+	r, ok := rule.Rule.(StoreLabelRule)
+	peers := region.GetPeers()
+	if !ok || l.stores == nil || len(peers) == 0 {
+		return false
+	}
+	for _, p := range peers {
+		store := l.stores.GetStore(p.GetStoreId())
+		if store == nil || !storeMatchesLabels(store, r.Labels) {
+			return false
+		}
+	}
+	return true
+}
+
+func storeMatchesLabels(store *core.StoreInfo, selector []StoreLabel) bool {
+	for _, want := range selector {
+		if store.GetLabelValue(want.Key) != want.Value {
+			return false
+		}
+	}
+	return true
+}
+
+// emit bumps the revision, records the event in the ring buffer, and queues
+// it onto every subscriber's pending list; it never sends to a subscriber's
+// channel directly. Each subscriber has exactly one goroutine (started by
+// Watch) draining its pending list into its channel in order, so a live
+// event can never overtake backlog the same subscriber is still replaying.
+// A subscriber whose pending list grows past watchHistoryLimit has its
+// oldest queued events dropped, the same way the history ring buffer is
+// bounded; it will notice the gap in revisions and can resume with Watch,
+// hitting ErrCompacted if it fell too far behind.
+func (l *RegionLabeler) emit(typ LabelRuleEventType, rule *LabelRule) {
+	l.watchMu.Lock()
+	defer l.watchMu.Unlock()
+	l.revision++
+	event := LabelRuleEvent{Type: typ, Rule: rule, Revision: l.revision}
+	l.events = append(l.events, event)
+	if len(l.events) > watchHistoryLimit {
+		l.events = l.events[len(l.events)-watchHistoryLimit:]
+	}
+	for _, sub := range l.subscribers {
+		sub.pending = append(sub.pending, event)
+		if len(sub.pending) > watchHistoryLimit {
+			sub.pending = sub.pending[len(sub.pending)-watchHistoryLimit:]
+		}
+		select {
+		case sub.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Watch subscribes to label rule mutations, replaying any retained events
+// after revision before delivering new ones. A revision of 0 subscribes to
+// new events only. If revision has already fallen out of the retained
+// history, Watch returns ErrCompacted. The returned channel is removed from
+// the subscriber set once ctx is done.
+func (l *RegionLabeler) Watch(ctx context.Context, revision uint64) (<-chan LabelRuleEvent, error) {
+	l.watchMu.Lock()
+	var backlog []LabelRuleEvent
+	if revision > 0 && revision < l.revision {
+		oldest := l.revision + 1
+		if len(l.events) > 0 {
+			oldest = l.events[0].Revision
+		}
+		if revision < oldest-1 {
+			l.watchMu.Unlock()
+			return nil, ErrCompacted
+		}
+		for _, e := range l.events {
+			if e.Revision > revision {
+				backlog = append(backlog, e)
+			}
+		}
+	}
+
+	ch := make(chan LabelRuleEvent, watchBufferSize)
+	sub := &labelRuleSubscriber{pending: backlog, wake: make(chan struct{}, 1)}
+	l.subscribers[ch] = sub
+	l.watchMu.Unlock()
+
+	// A single goroutine owns both backlog replay and all later live
+	// delivery for this subscriber: it repeatedly drains sub.pending (which
+	// emit only ever appends to, under watchMu) into ch, so everything
+	// reaches ch in the order emit recorded it.
+	go func() {
+		defer func() {
+			l.watchMu.Lock()
+			delete(l.subscribers, ch)
+			l.watchMu.Unlock()
+		}()
+		for {
+			l.watchMu.Lock()
+			pending := sub.pending
+			sub.pending = nil
+			l.watchMu.Unlock()
+
+			for _, e := range pending {
+				select {
+				case ch <- e:
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			select {
+			case <-sub.wake:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+// runGC periodically evicts expired label rules.
+func (l *RegionLabeler) runGC() {
+	ticker := time.NewTicker(labelGCInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			l.gcExpiredRules()
+		case <-l.ctx.Done():
+			return
+		}
+	}
+}
+
+func (l *RegionLabeler) gcExpiredRules() {
+	l.RLock()
+	var expired []string
+	for id, rule := range l.labelRules {
+		if rule.Expired() {
+			expired = append(expired, id)
+		}
+	}
+	l.RUnlock()
+
+	for _, id := range expired {
+		if err := l.DeleteLabelRule(id); err != nil {
+			log.Error("failed to delete expired label rule", zap.String("rule-id", id), zap.Error(err))
+			continue
+		}
+		log.Info("label rule expired, removed by GC", zap.String("rule-id", id))
+	}
+}
+
 func (l *RegionLabeler) loadRules() error {
 	var toDelete []string
 	err := l.storage.LoadRegionRules(func(k, v string) {
@@ -60,6 +283,10 @@ func (l *RegionLabeler) loadRules() error {
 			toDelete = append(toDelete, k)
 			return
 		}
+		if r.Expired() {
+			toDelete = append(toDelete, k)
+			return
+		}
 		l.labelRules[r.ID] = &r
 	})
 	if err != nil {
@@ -74,6 +301,9 @@ func (l *RegionLabeler) loadRules() error {
 }
 
 func (l *RegionLabeler) adjustRule(rule *LabelRule) error {
+	if err := adjustRuleExpire(rule); err != nil {
+		return err
+	}
 	switch rule.RuleType {
 	case KeyRange:
 		data, ok := rule.Rule.(map[string]string)
@@ -95,8 +325,62 @@ func (l *RegionLabeler) adjustRule(rule *LabelRule) error {
 			return errs.ErrRegionRuleContent.FastGenByArgs("endKey should be greater than startKey")
 		}
 		rule.Rule = r
+	case TiDBTable:
+		data, ok := rule.Rule.(map[string]interface{})
+		if !ok {
+			return errs.ErrRegionRuleContent.FastGenByArgs("invalid rule type")
+		}
+		id, ok := data["id"].(float64)
+		if !ok {
+			return errs.ErrRegionRuleContent.FastGenByArgs("table/partition id is required")
+		}
+		rule.Rule = newTiDBTableRule(int64(id))
+	case StoreLabelSelector:
+		data, ok := rule.Rule.(map[string]interface{})
+		if !ok {
+			return errs.ErrRegionRuleContent.FastGenByArgs("invalid rule type")
+		}
+		labelsRaw, ok := data["labels"].([]interface{})
+		if !ok || len(labelsRaw) == 0 {
+			return errs.ErrRegionRuleContent.FastGenByArgs("store label selector requires at least one label")
+		}
+		var r StoreLabelRule
+		for _, item := range labelsRaw {
+			m, ok := item.(map[string]interface{})
+			if !ok {
+				return errs.ErrRegionRuleContent.FastGenByArgs("invalid store label selector")
+			}
+			key, _ := m["key"].(string)
+			if key == "" {
+				return errs.ErrRegionRuleContent.FastGenByArgs("store label key is required")
+			}
+			value, _ := m["value"].(string)
+			r.Labels = append(r.Labels, StoreLabel{Key: key, Value: value})
+		}
+		rule.Rule = r
+	default:
+		return errs.ErrRegionRuleContent.FastGenByArgs(fmt.Sprintf("invalid rule type: %s", rule.RuleType))
+	}
+	return nil
+}
+
+// adjustRuleExpire parses rule.TTL, if set, into an absolute ExpireAt, then
+// clears TTL. Clearing it is what makes the conversion idempotent across a
+// reload: loadRules runs every persisted rule back through adjustRule on
+// startup, and a TTL left in place would be reinterpreted relative to
+// time.Now() on every restart, pushing ExpireAt out indefinitely instead of
+// the rule ever actually expiring.
+func adjustRuleExpire(rule *LabelRule) error {
+	if rule.TTL == "" {
+		return nil
 	}
-	return errs.ErrRegionRuleContent.FastGenByArgs(fmt.Sprintf("invalid rule type: %s", rule.RuleType))
+	ttl, err := time.ParseDuration(rule.TTL)
+	if err != nil {
+		return errs.ErrRegionRuleContent.FastGenByArgs(fmt.Sprintf("invalid ttl %q: %v", rule.TTL, err))
+	}
+	rule.ExpireAt = time.Now().Add(ttl).UnixNano() / int64(time.Millisecond)
+	rule.TTL = ""
+	return nil
 }
 
 // GetAllLabelRules returns all the rules.
@@ -105,7 +389,7 @@ func (l *RegionLabeler) GetAllLabelRules() []*LabelRule {
 	defer l.RUnlock()
 	rules := make([]*LabelRule, 0, len(l.labelRules))
 	for _, rule := range l.labelRules {
-		rules = append(rules, rule)
+		rules = append(rules, rule.withRemainingTTL())
 	}
 	return rules
 }
@@ -114,7 +398,11 @@ func (l *RegionLabeler) GetAllLabelRules() []*LabelRule {
 func (l *RegionLabeler) GetLabelRule(id string) *LabelRule {
 	l.RLock()
 	defer l.RUnlock()
-	return l.labelRules[id]
+	rule, ok := l.labelRules[id]
+	if !ok {
+		return nil
+	}
+	return rule.withRemainingTTL()
 }
 
 // SetLabelRule inserts or updates a LabelRule.
@@ -128,6 +416,7 @@ func (l *RegionLabeler) SetLabelRule(rule *LabelRule) error {
 		return err
 	}
 	l.labelRules[rule.ID] = rule
+	l.emit(EventPut, rule)
 	return nil
 }
 
@@ -138,16 +427,185 @@ func (l *RegionLabeler) DeleteLabelRule(id string) error {
 	if err := l.storage.DeleteRegionRule(id); err != nil {
 		return err
 	}
+	rule, ok := l.labelRules[id]
 	delete(l.labelRules, id)
+	if ok {
+		l.emit(EventDelete, rule)
+	}
+	return nil
+}
+
+// Patch applies a batch of LabelRulePatch operations atomically: all rules
+// to be set must pass adjustRule before anything is persisted, and if
+// writing any operation to storage fails, the operations already persisted
+// in this batch are rolled back.
+func (l *RegionLabeler) Patch(patch []*LabelRulePatch) error {
+	l.Lock()
+	defer l.Unlock()
+
+	for _, p := range patch {
+		if p.Rule == nil {
+			return errs.ErrRegionRuleContent.FastGenByArgs("rule is required")
+		}
+		if p.Action != RuleOpSet && p.Action != RuleOpDelete {
+			return errs.ErrRegionRuleContent.FastGenByArgs(fmt.Sprintf("invalid patch action: %s", p.Action))
+		}
+	}
+
+	for _, p := range patch {
+		if p.Action == RuleOpSet {
+			if err := l.adjustRule(p.Rule); err != nil {
+				return err
+			}
+		}
+	}
+
+	applied := make([]*LabelRulePatch, 0, len(patch))
+	rollback := func() {
+		for _, p := range applied {
+			old, hadOld := l.labelRules[p.Rule.ID]
+			if hadOld {
+				l.storage.SaveRegionRule(p.Rule.ID, old)
+			} else {
+				l.storage.DeleteRegionRule(p.Rule.ID)
+			}
+		}
+	}
+
+	for _, p := range patch {
+		var err error
+		switch p.Action {
+		case RuleOpSet:
+			err = l.storage.SaveRegionRule(p.Rule.ID, p.Rule)
+		case RuleOpDelete:
+			err = l.storage.DeleteRegionRule(p.Rule.ID)
+		}
+		if err != nil {
+			rollback()
+			return err
+		}
+		applied = append(applied, p)
+	}
+
+	for _, p := range patch {
+		switch p.Action {
+		case RuleOpSet:
+			l.labelRules[p.Rule.ID] = p.Rule
+			l.emit(EventPut, p.Rule)
+		case RuleOpDelete:
+			old, ok := l.labelRules[p.Rule.ID]
+			delete(l.labelRules, p.Rule.ID)
+			if ok {
+				l.emit(EventDelete, old)
+			}
+		}
+	}
+	return nil
+}
+
+// ReconcileLabelRules sets rules as the desired state for owner, deleting
+// any existing rule tagged with the same owner that is not present in
+// rules. This lets external controllers (e.g. TiDB placement rules, backup
+// tools) manage their own slice of the label namespace without racing each
+// other. A rule ID currently owned by a different owner is rejected rather
+// than reassigned, so one controller can't silently steal another's rule.
+func (l *RegionLabeler) ReconcileLabelRules(owner string, rules []*LabelRule) error {
+	l.Lock()
+	defer l.Unlock()
+
+	for _, r := range rules {
+		if r == nil {
+			return errs.ErrRegionRuleContent.FastGenByArgs("rule is required")
+		}
+	}
+
+	for _, r := range rules {
+		if existing, ok := l.labelRules[r.ID]; ok && existing.Owner != "" && existing.Owner != owner {
+			return errs.ErrRegionRuleContent.FastGenByArgs(fmt.Sprintf("rule %s is owned by %q", r.ID, existing.Owner))
+		}
+	}
+
+	for _, r := range rules {
+		r.Owner = owner
+		if err := l.adjustRule(r); err != nil {
+			return err
+		}
+	}
+
+	keep := make(map[string]struct{}, len(rules))
+	for _, r := range rules {
+		keep[r.ID] = struct{}{}
+	}
+	var toDelete []string
+	for id, r := range l.labelRules {
+		if r.Owner != owner {
+			continue
+		}
+		if _, ok := keep[id]; !ok {
+			toDelete = append(toDelete, id)
+		}
+	}
+
+	var written []string
+	rollback := func() {
+		for _, id := range written {
+			if old, ok := l.labelRules[id]; ok {
+				l.storage.SaveRegionRule(id, old)
+			} else {
+				l.storage.DeleteRegionRule(id)
+			}
+		}
+	}
+	for _, r := range rules {
+		if err := l.storage.SaveRegionRule(r.ID, r); err != nil {
+			rollback()
+			return err
+		}
+		written = append(written, r.ID)
+	}
+	for _, id := range toDelete {
+		if err := l.storage.DeleteRegionRule(id); err != nil {
+			rollback()
+			return err
+		}
+		written = append(written, id)
+	}
+
+	for _, r := range rules {
+		l.labelRules[r.ID] = r
+		l.emit(EventPut, r)
+	}
+	for _, id := range toDelete {
+		if old, ok := l.labelRules[id]; ok {
+			delete(l.labelRules, id)
+			l.emit(EventDelete, old)
+		}
+	}
 	return nil
 }
 
+// txnScopeLabelKey is the label key that GetRegionTxnScope consults. It is
+// the per-region counterpart to the store-label-derived txn scope that
+// TiDB's stale-read path uses today, letting operators pin subsets of the
+// keyspace to a scope independently of replica placement.
+const txnScopeLabelKey = "txn_scope"
+
+// GetRegionTxnScope returns the txn_scope label of region, or "" if no
+// rule assigns one. The server surfaces this on the region info returned
+// to clients and uses it to answer ValidateStaleRead.
+func (l *RegionLabeler) GetRegionTxnScope(region *core.RegionInfo) string {
+	return l.GetRegionLabel(region, txnScopeLabelKey)
+}
+
 // GetRegionLabel returns the label of the region for a key.
 func (l *RegionLabeler) GetRegionLabel(region *core.RegionInfo, key string) string {
 	l.RLock()
 	defer l.RUnlock()
 	for _, rule := range l.labelRules {
-		if rule.IsMatch(region) {
+		if rule.Expired() {
+			continue
+		}
+		if l.ruleMatches(rule, region) {
 			for _, label := range rule.Labels {
 				if label.Key == key {
 					return label.Value
@@ -164,7 +622,10 @@ func (l *RegionLabeler) GetRegionLabels(region *core.RegionInfo) []*RegionLabel
 	defer l.RUnlock()
 	var result []*RegionLabel
 	for _, rule := range l.labelRules {
-		if rule.IsMatch(region) {
+		if rule.Expired() {
+			continue
+		}
+		if l.ruleMatches(rule, region) {
 			for _, label := range rule.Labels {
 				result = append(result, &RegionLabel{
 					Key:   label.Key,
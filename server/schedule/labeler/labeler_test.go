@@ -0,0 +1,277 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package labeler
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/pingcap/kvproto/pkg/metapb"
+	"github.com/stretchr/testify/require"
+	"github.com/tikv/pd/server/core"
+	"github.com/tikv/pd/server/kv"
+)
+
+func newTestRegionLabeler(t *testing.T) *RegionLabeler {
+	l, err := NewRegionLabeler(core.NewStorage(kv.NewMemoryKV()))
+	require.NoError(t, err)
+	return l
+}
+
+func newTestRegion(id uint64) *core.RegionInfo {
+	return core.NewRegionInfo(&metapb.Region{Id: id}, nil)
+}
+
+func newTestKeyRangeRule(id string) *LabelRule {
+	return &LabelRule{
+		ID:       id,
+		Labels:   []RegionLabel{{Key: "k", Value: "v"}},
+		RuleType: KeyRange,
+		Rule:     map[string]string{"start_key": "", "end_key": ""},
+	}
+}
+
+func TestPatchAllOrNothingOnValidationFailure(t *testing.T) {
+	re := require.New(t)
+	l := newTestRegionLabeler(t)
+
+	err := l.Patch([]*LabelRulePatch{
+		{Action: RuleOpSet, Rule: newTestKeyRangeRule("good")},
+		{Action: RuleOpSet, Rule: &LabelRule{ID: "bad", RuleType: "not-a-real-type"}},
+	})
+	re.Error(err)
+	re.Nil(l.GetLabelRule("good"))
+	re.Nil(l.GetLabelRule("bad"))
+}
+
+func TestPatchRejectsNilRule(t *testing.T) {
+	re := require.New(t)
+	l := newTestRegionLabeler(t)
+
+	re.Error(l.Patch([]*LabelRulePatch{{Action: RuleOpDelete}}))
+}
+
+func TestReconcileLabelRulesRejectsNilRule(t *testing.T) {
+	re := require.New(t)
+	l := newTestRegionLabeler(t)
+
+	re.Error(l.ReconcileLabelRules("owner", []*LabelRule{nil}))
+}
+
+func TestReconcileLabelRulesRejectsOwnerConflict(t *testing.T) {
+	re := require.New(t)
+	l := newTestRegionLabeler(t)
+
+	rule := newTestKeyRangeRule("shared")
+	re.NoError(l.ReconcileLabelRules("owner-a", []*LabelRule{rule}))
+
+	re.Error(l.ReconcileLabelRules("owner-b", []*LabelRule{newTestKeyRangeRule("shared")}))
+	re.Equal("owner-a", l.GetLabelRule("shared").Owner)
+}
+
+func TestWatchReplaysBacklogAfterRevision(t *testing.T) {
+	re := require.New(t)
+	l := newTestRegionLabeler(t)
+
+	re.NoError(l.SetLabelRule(newTestKeyRangeRule("before")))
+	fromRevision := l.revision
+
+	re.NoError(l.SetLabelRule(newTestKeyRangeRule("after-1")))
+	re.NoError(l.SetLabelRule(newTestKeyRangeRule("after-2")))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch, err := l.Watch(ctx, fromRevision)
+	re.NoError(err)
+
+	seen := map[string]bool{}
+	var revisions []uint64
+	for len(seen) < 2 {
+		select {
+		case e := <-ch:
+			seen[e.Rule.ID] = true
+			revisions = append(revisions, e.Revision)
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for replayed events, got %v", seen)
+		}
+	}
+	re.True(seen["after-1"])
+	re.True(seen["after-2"])
+	re.True(sort.SliceIsSorted(revisions, func(i, j int) bool { return revisions[i] < revisions[j] }))
+}
+
+// TestWatchDeliversBacklogAndLiveEventsInOrder guards against backlog
+// replay and emit's live fan-out racing on the same channel: a subscriber
+// that reconnects with a backlog pending must see every one of those
+// events, in revision order, before any event emitted after it subscribed.
+func TestWatchDeliversBacklogAndLiveEventsInOrder(t *testing.T) {
+	re := require.New(t)
+	l := newTestRegionLabeler(t)
+
+	re.NoError(l.SetLabelRule(newTestKeyRangeRule("baseline")))
+	fromRevision := l.revision
+
+	const backlogSize = 20
+	for i := 0; i < backlogSize; i++ {
+		re.NoError(l.SetLabelRule(newTestKeyRangeRule(fmt.Sprintf("backlog-%d", i))))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch, err := l.Watch(ctx, fromRevision)
+	re.NoError(err)
+
+	const liveSize = 20
+	go func() {
+		for i := 0; i < liveSize; i++ {
+			l.SetLabelRule(newTestKeyRangeRule(fmt.Sprintf("live-%d", i)))
+		}
+	}()
+
+	var revisions []uint64
+	for i := 0; i < backlogSize+liveSize; i++ {
+		select {
+		case e := <-ch:
+			revisions = append(revisions, e.Revision)
+		case <-time.After(time.Second):
+			t.Fatalf("timed out after %d/%d events", len(revisions), backlogSize+liveSize)
+		}
+	}
+	re.True(sort.SliceIsSorted(revisions, func(i, j int) bool { return revisions[i] < revisions[j] }))
+}
+
+func TestWatchReturnsErrCompactedForOldRevision(t *testing.T) {
+	re := require.New(t)
+	l := newTestRegionLabeler(t)
+
+	for i := 0; i < watchHistoryLimit+10; i++ {
+		re.NoError(l.SetLabelRule(newTestKeyRangeRule(fmt.Sprintf("rule-%d", i))))
+	}
+
+	_, err := l.Watch(context.Background(), 1)
+	re.ErrorIs(err, ErrCompacted)
+}
+
+func TestLabelRuleExpired(t *testing.T) {
+	re := require.New(t)
+	rule := newTestKeyRangeRule("expiring")
+	re.False(rule.Expired())
+	rule.ExpireAt = time.Now().Add(-time.Minute).UnixNano() / int64(time.Millisecond)
+	re.True(rule.Expired())
+}
+
+func TestSetLabelRuleTTLExpireAtSurvivesReload(t *testing.T) {
+	re := require.New(t)
+	storage := core.NewStorage(kv.NewMemoryKV())
+	l, err := NewRegionLabeler(storage)
+	re.NoError(err)
+
+	rule := newTestKeyRangeRule("ttl-rule")
+	rule.TTL = "1h"
+	re.NoError(l.SetLabelRule(rule))
+
+	before := l.GetLabelRule("ttl-rule")
+	re.NotNil(before)
+	re.NotZero(before.ExpireAt)
+
+	// Reloading from storage (as happens on a restart) must not recompute
+	// ExpireAt from the original TTL, or the rule would never expire.
+	reloaded, err := NewRegionLabeler(storage)
+	re.NoError(err)
+	after := reloaded.GetLabelRule("ttl-rule")
+	re.NotNil(after)
+	re.Equal(before.ExpireAt, after.ExpireAt)
+}
+
+func TestGCExpiredRules(t *testing.T) {
+	re := require.New(t)
+	l := newTestRegionLabeler(t)
+
+	rule := newTestKeyRangeRule("expired")
+	rule.ExpireAt = time.Now().Add(-time.Minute).UnixNano() / int64(time.Millisecond)
+	l.labelRules[rule.ID] = rule
+	re.NoError(l.storage.SaveRegionRule(rule.ID, rule))
+
+	l.gcExpiredRules()
+	re.Nil(l.GetLabelRule("expired"))
+}
+
+func TestGetRegionTxnScope(t *testing.T) {
+	re := require.New(t)
+	l := newTestRegionLabeler(t)
+
+	region := newTestRegion(1)
+	re.Equal("", l.GetRegionTxnScope(region))
+
+	rule := newTestKeyRangeRule("txn-scope")
+	rule.Labels = []RegionLabel{{Key: txnScopeLabelKey, Value: "dc-1"}}
+	re.NoError(l.SetLabelRule(rule))
+	re.Equal("dc-1", l.GetRegionTxnScope(region))
+}
+
+func TestAdjustRuleTiDBTable(t *testing.T) {
+	re := require.New(t)
+	l := newTestRegionLabeler(t)
+
+	rule := &LabelRule{
+		ID:       "table-1",
+		RuleType: TiDBTable,
+		Rule:     map[string]interface{}{"id": float64(7)},
+	}
+	re.NoError(l.adjustRule(rule))
+
+	r, ok := rule.Rule.(TiDBTableRule)
+	re.True(ok)
+	re.EqualValues(7, r.ID)
+	want := newTiDBTableRule(7)
+	re.Equal(want.StartKeyHex, r.StartKeyHex)
+	re.Equal(want.EndKeyHex, r.EndKeyHex)
+}
+
+func TestAdjustRuleStoreLabelSelector(t *testing.T) {
+	re := require.New(t)
+	l := newTestRegionLabeler(t)
+
+	rule := &LabelRule{
+		ID:       "selector-1",
+		RuleType: StoreLabelSelector,
+		Rule: map[string]interface{}{
+			"labels": []interface{}{
+				map[string]interface{}{"key": "zone", "value": "us-east"},
+			},
+		},
+	}
+	re.NoError(l.adjustRule(rule))
+
+	r, ok := rule.Rule.(StoreLabelRule)
+	re.True(ok)
+	re.Len(r.Labels, 1)
+	re.Equal("zone", r.Labels[0].Key)
+	re.Equal("us-east", r.Labels[0].Value)
+}
+
+func TestAdjustRuleStoreLabelSelectorRequiresLabels(t *testing.T) {
+	re := require.New(t)
+	l := newTestRegionLabeler(t)
+
+	rule := &LabelRule{
+		ID:       "selector-empty",
+		RuleType: StoreLabelSelector,
+		Rule:     map[string]interface{}{"labels": []interface{}{}},
+	}
+	re.Error(l.adjustRule(rule))
+}
@@ -0,0 +1,200 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package labeler
+
+import (
+	"bytes"
+	"encoding/hex"
+	"time"
+
+	"github.com/pingcap/tidb/tablecodec"
+	"github.com/tikv/pd/server/core"
+)
+
+// RuleType defines the rule type.
+type RuleType string
+
+const (
+	// KeyRange is the rule type that labels regions within a key range.
+	KeyRange RuleType = "key-range"
+	// TiDBTable is the rule type that labels regions belonging to a TiDB
+	// table or partition, identified by its (physical) table ID.
+	TiDBTable RuleType = "tidb-table"
+	// StoreLabelSelector is the rule type that labels regions whose every
+	// replica resides on a store matching a set of store labels.
+	StoreLabelSelector RuleType = "store-label"
+)
+
+// LabelRule is the rule to assign labels to a region.
+// NOTE: LabelRule is not updatable in place; setting a rule with an existing
+// ID replaces the old rule as a whole.
+type LabelRule struct {
+	ID       string        `json:"id"`
+	Labels   []RegionLabel `json:"labels"`
+	RuleType RuleType      `json:"rule_type"`
+	Rule     interface{}   `json:"rule"`
+	// Owner, if set, marks the rule as managed by an external controller.
+	// ReconcileLabelRules uses it to replace a controller's full set of
+	// rules atomically without disturbing rules owned by others.
+	Owner string `json:"owner,omitempty"`
+	// TTL specifies how long the rule should live, e.g. "1h30m". On input
+	// it is parsed into ExpireAt and discarded; on output from the API, it
+	// instead reports the time remaining until the rule expires.
+	TTL string `json:"ttl,omitempty"`
+	// ExpireAt is the unix millisecond timestamp after which the rule is
+	// considered expired: it is ignored by matching and removed by the
+	// background GC.
+	ExpireAt int64 `json:"expire_at,omitempty"`
+}
+
+// Expired returns whether the rule's TTL has elapsed.
+func (rule *LabelRule) Expired() bool {
+	return rule.ExpireAt > 0 && rule.ExpireAt <= time.Now().UnixNano()/int64(time.Millisecond)
+}
+
+// withRemainingTTL returns a copy of rule with TTL rewritten to the time
+// left until expiry, for surfacing to API clients. Rules without an
+// ExpireAt are returned unmodified.
+func (rule *LabelRule) withRemainingTTL() *LabelRule {
+	if rule.ExpireAt == 0 {
+		return rule
+	}
+	remaining := time.Until(time.Unix(0, rule.ExpireAt*int64(time.Millisecond)))
+	if remaining < 0 {
+		remaining = 0
+	}
+	clone := *rule
+	clone.TTL = remaining.String()
+	return &clone
+}
+
+// RegionLabel is the label of a region.
+type RegionLabel struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// KeyRangeRule contains the start key and end key of the LabelRule.
+type KeyRangeRule struct {
+	StartKey    []byte `json:"-"`
+	StartKeyHex string `json:"start_key"`
+	EndKey      []byte `json:"-"`
+	EndKeyHex   string `json:"end_key"`
+}
+
+// TiDBTableRule labels a TiDB table or partition, identified by its
+// (physical) table ID. adjustRule derives KeyRangeRule from ID using the
+// standard TiDB codec, so callers don't have to hand-encode hex keys.
+type TiDBTableRule struct {
+	ID int64 `json:"id"`
+	KeyRangeRule
+}
+
+// newTiDBTableRule builds the KeyRangeRule covering table/partition id's
+// row data, i.e. [t{id}_r, t{id+1}). This excludes index data: TiDB's
+// index-key prefix t{id}_i sorts before t{id}_r ('i' < 'r'), so it falls
+// outside the range on the low end.
+func newTiDBTableRule(id int64) TiDBTableRule {
+	start := tablecodec.GenTableRecordPrefix(id)
+	end := tablecodec.EncodeTablePrefix(id + 1)
+	return TiDBTableRule{
+		ID: id,
+		KeyRangeRule: KeyRangeRule{
+			StartKey:    start,
+			StartKeyHex: hex.EncodeToString(start),
+			EndKey:      end,
+			EndKeyHex:   hex.EncodeToString(end),
+		},
+	}
+}
+
+// StoreLabel is a single key=value store-label matcher.
+type StoreLabel struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// StoreLabelRule labels a region when every one of its peers lives on a
+// store whose labels satisfy all the given matchers.
+type StoreLabelRule struct {
+	Labels []StoreLabel `json:"labels"`
+}
+
+// IsMatch returns whether a region matches the rule. It only handles rule
+// types that can be decided from the region alone; StoreLabelSelector also
+// needs live store labels and is evaluated by RegionLabeler.ruleMatches.
+func (rule *LabelRule) IsMatch(region *core.RegionInfo) bool {
+	switch rule.RuleType {
+	case KeyRange:
+		r, ok := rule.Rule.(KeyRangeRule)
+		if !ok {
+			return false
+		}
+		return keyRangeContains(r, region)
+	case TiDBTable:
+		r, ok := rule.Rule.(TiDBTableRule)
+		if !ok {
+			return false
+		}
+		return keyRangeContains(r.KeyRangeRule, region)
+	default:
+		return false
+	}
+}
+
+func keyRangeContains(r KeyRangeRule, region *core.RegionInfo) bool {
+	if bytes.Compare(region.GetStartKey(), r.StartKey) < 0 {
+		return false
+	}
+	if len(r.EndKey) == 0 {
+		return true
+	}
+	return len(region.GetEndKey()) > 0 && bytes.Compare(region.GetEndKey(), r.EndKey) <= 0
+}
+
+// RuleOpType defines the operation carried by a LabelRulePatch.
+type RuleOpType string
+
+const (
+	// RuleOpSet sets (inserts or updates) a LabelRule.
+	RuleOpSet RuleOpType = "set"
+	// RuleOpDelete deletes a LabelRule.
+	RuleOpDelete RuleOpType = "delete"
+)
+
+// LabelRulePatch is a single operation of a batch rule update, as accepted
+// by RegionLabeler.Patch.
+type LabelRulePatch struct {
+	Action RuleOpType `json:"action"`
+	Rule   *LabelRule `json:"rule"`
+}
+
+// LabelRuleEventType enumerates the kinds of mutation a LabelRuleEvent can
+// carry.
+type LabelRuleEventType string
+
+const (
+	// EventPut is emitted when a rule is inserted or updated.
+	EventPut LabelRuleEventType = "PUT"
+	// EventDelete is emitted when a rule is removed.
+	EventDelete LabelRuleEventType = "DELETE"
+)
+
+// LabelRuleEvent describes a single mutation to the label rule set, as
+// delivered by RegionLabeler.Watch.
+type LabelRuleEvent struct {
+	Type     LabelRuleEventType `json:"type"`
+	Rule     *LabelRule         `json:"rule"`
+	Revision uint64             `json:"revision"`
+}